@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+const (
+	batchMediaType   = "application/vnd.ytconv+json"
+	resolveCacheTTL  = 10 * time.Minute
+	batchWorkerCount = 4
+)
+
+// BatchRequest is the request body for POST /batch, modeled on the git-lfs
+// batch protocol.
+type BatchRequest struct {
+	Operation string        `json:"operation"`
+	Type      string        `json:"type"`
+	Objects   []BatchObject `json:"objects"`
+}
+
+// BatchObject identifies a single video to resolve within a batch request.
+type BatchObject struct {
+	URL  string `json:"url"`
+	Itag int    `json:"itag,omitempty"`
+}
+
+// BatchResponse is the response body for POST /batch.
+type BatchResponse struct {
+	Objects []BatchObjectResult `json:"objects"`
+}
+
+// BatchObjectResult carries the outcome for one object in a batch request.
+type BatchObjectResult struct {
+	URL     string                 `json:"url"`
+	Status  string                 `json:"status"`
+	Actions map[string]BatchAction `json:"actions,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// BatchAction describes an href the client can act on, git-lfs style.
+type BatchAction struct {
+	Href      string            `json:"href"`
+	ExpiresAt string            `json:"expires_at,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// resolveCacheEntry caches a resolved download URL for a (videoID, type,
+// itag) key so repeated batch requests don't re-resolve the same video.
+type resolveCacheEntry struct {
+	url       string
+	filename  string
+	mimeType  string
+	expiresAt time.Time
+}
+
+var (
+	resolveCacheMu sync.Mutex
+	resolveCache   = map[string]resolveCacheEntry{}
+)
+
+func resolveCacheKey(videoID, conversionType string, itag int) string {
+	return fmt.Sprintf("%s:%s:%d", videoID, conversionType, itag)
+}
+
+func resolveCacheGet(key string) (resolveCacheEntry, bool) {
+	resolveCacheMu.Lock()
+	defer resolveCacheMu.Unlock()
+	entry, ok := resolveCache[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return resolveCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func resolveCacheSet(key string, entry resolveCacheEntry) {
+	resolveCacheMu.Lock()
+	defer resolveCacheMu.Unlock()
+	entry.expiresAt = time.Now().Add(resolveCacheTTL)
+	resolveCache[key] = entry
+}
+
+// batchHandler implements POST /batch: it expands any playlist URLs into
+// their constituent videos, resolves every object concurrently through a
+// bounded worker pool, and returns download actions git-lfs style.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	if r.Method != http.MethodPost {
+		writeError(w, r, ErrMissingParameter, "/batch only accepts POST")
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, ErrUpstreamDecodeError, fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+	if req.Operation != "convert" || !isValidConversionType(req.Type) {
+		writeError(w, r, ErrInvalidConversionType, "operation must be 'convert' and type must be 'mp3', 'mp4', or 'merged'")
+		return
+	}
+
+	objects, err := expandBatchObjects(req.Objects)
+	if err != nil {
+		writeError(w, r, ErrUpstreamUnavailable, fmt.Sprintf("failed to expand playlist: %v", err))
+		return
+	}
+
+	results := resolveBatchObjects(objects, req.Type)
+	writeJSON(w, http.StatusOK, BatchResponse{Objects: results})
+}
+
+// expandBatchObjects replaces any playlist URL with one object per video it
+// contains, leaving ordinary video URLs untouched.
+func expandBatchObjects(objects []BatchObject) ([]BatchObject, error) {
+	expanded := make([]BatchObject, 0, len(objects))
+	for _, obj := range objects {
+		if !isPlaylistURL(obj.URL) {
+			expanded = append(expanded, obj)
+			continue
+		}
+
+		playlist, err := youtubeClient.GetPlaylist(obj.URL)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range playlist.Videos {
+			expanded = append(expanded, BatchObject{URL: entry.ID, Itag: obj.Itag})
+		}
+	}
+	return expanded, nil
+}
+
+// playlistIDRegex matches the same "list" query value shape the youtube
+// client itself requires (see its unexported playlistInURLRegex), so values
+// like "list=WL" or "list=LL" from a Watch Later/Mix link aren't mistaken
+// for a real playlist ID and sent to GetPlaylist.
+var playlistIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{13,42}$`)
+
+// isPlaylistURL reports whether url carries a YouTube playlist's "list"
+// query parameter with a real playlist ID, as opposed to a single video URL
+// or a non-playlist list value such as Watch Later ("WL") or a Mix.
+func isPlaylistURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return playlistIDRegex.MatchString(parsed.Query().Get("list"))
+}
+
+// resolveBatchObjects resolves every object concurrently through a bounded
+// worker pool and preserves the input order in the result slice.
+func resolveBatchObjects(objects []BatchObject, conversionType string) []BatchObjectResult {
+	results := make([]BatchObjectResult, len(objects))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < batchWorkerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = resolveBatchObject(objects[idx], conversionType)
+			}
+		}()
+	}
+	for idx := range objects {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func resolveBatchObject(obj BatchObject, conversionType string) BatchObjectResult {
+	videoID, err := youtube.ExtractVideoID(obj.URL)
+	if err != nil {
+		return BatchObjectResult{URL: obj.URL, Status: "error", Error: err.Error()}
+	}
+
+	key := resolveCacheKey(videoID, conversionType, obj.Itag)
+	entry, ok := resolveCacheGet(key)
+	if !ok {
+		resolvedURL, filename, mimeType, err := resolveDownload(batchSelectorRequest(obj), obj.URL, conversionType)
+		if err != nil {
+			return BatchObjectResult{URL: obj.URL, Status: "error", Error: err.Error()}
+		}
+		entry = resolveCacheEntry{url: resolvedURL, filename: filename, mimeType: mimeType}
+		resolveCacheSet(key, entry)
+	}
+
+	return BatchObjectResult{
+		URL:    obj.URL,
+		Status: "ok",
+		Actions: map[string]BatchAction{
+			"download": {
+				Href:      entry.url,
+				ExpiresAt: time.Now().Add(resolveCacheTTL).Format(time.RFC3339),
+				Headers:   map[string]string{"Content-Type": entry.mimeType},
+			},
+			"verify": {Href: "/verify"},
+		},
+	}
+}
+
+// batchSelectorRequest builds a throwaway *http.Request carrying an object's
+// itag so it can be passed through resolveDownload/selectFormat unchanged.
+func batchSelectorRequest(obj BatchObject) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "/batch", nil)
+	q := req.URL.Query()
+	if obj.Itag != 0 {
+		q.Set("itag", fmt.Sprintf("%d", obj.Itag))
+	}
+	req.URL.RawQuery = q.Encode()
+	return req
+}
+
+// VerifyRequest is the body POSTed to /verify once a client has finished
+// downloading a batch object, so the server can log completion.
+type VerifyRequest struct {
+	URL string `json:"url"`
+}
+
+// verifyHandler implements POST /verify: clients call it after a successful
+// download so completion can be logged and any temp storage cleaned up.
+func verifyHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, ErrUpstreamDecodeError, fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+
+	log.Printf("Verified download for %s", req.URL)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ErrorCode is a stable, machine-readable identifier for an API error, safe
+// for clients to branch on (unlike the free-form message).
+type ErrorCode string
+
+const (
+	ErrInvalidConversionType  ErrorCode = "invalid_conversion_type"
+	ErrMissingParameter       ErrorCode = "missing_parameter"
+	ErrUpstreamUnavailable    ErrorCode = "upstream_unavailable"
+	ErrUpstreamStatusError    ErrorCode = "upstream_status_error"
+	ErrUpstreamDecodeError    ErrorCode = "upstream_decode_error"
+	ErrConversionFailed       ErrorCode = "conversion_failed"
+	ErrUnsupportedContentType ErrorCode = "unsupported_content_type"
+	ErrVideoUnavailable       ErrorCode = "video_unavailable"
+	ErrAgeRestricted          ErrorCode = "age_restricted"
+	ErrGeoBlocked             ErrorCode = "geo_blocked"
+	ErrRateLimited            ErrorCode = "rate_limited"
+	ErrNotFound               ErrorCode = "not_found"
+)
+
+// httpStatusForCode maps each ErrorCode to the HTTP status it's reported with.
+var httpStatusForCode = map[ErrorCode]int{
+	ErrInvalidConversionType:  http.StatusBadRequest,
+	ErrMissingParameter:       http.StatusBadRequest,
+	ErrUpstreamUnavailable:    http.StatusBadGateway,
+	ErrUpstreamStatusError:    http.StatusBadGateway,
+	ErrUpstreamDecodeError:    http.StatusBadGateway,
+	ErrConversionFailed:       http.StatusInternalServerError,
+	ErrUnsupportedContentType: http.StatusUnsupportedMediaType,
+	ErrVideoUnavailable:       http.StatusNotFound,
+	ErrAgeRestricted:          http.StatusForbidden,
+	ErrGeoBlocked:             http.StatusForbidden,
+	ErrRateLimited:            http.StatusTooManyRequests,
+	ErrNotFound:               http.StatusNotFound,
+}
+
+// ErrorResponse is the structured body returned for every API error, in
+// place of the plain-text bodies http.Error produces.
+type ErrorResponse struct {
+	ErrorCode ErrorCode `json:"error_code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// writeError writes a structured error response for code, tagging it with
+// the request ID that withRequestID stashed on the context.
+func writeError(w http.ResponseWriter, r *http.Request, code ErrorCode, message string) {
+	status, ok := httpStatusForCode[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, ErrorResponse{
+		ErrorCode: code,
+		Message:   message,
+		RequestID: requestIDFromContext(r.Context()),
+	})
+}
+
+// classifyUpstreamError maps an error surfaced while resolving/downloading a
+// video to the most specific ErrorCode we can justify from its text, falling
+// back to the generic upstream_unavailable code.
+func classifyUpstreamError(err error) ErrorCode {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "private") || strings.Contains(msg, "not found") || strings.Contains(msg, "unavailable"):
+		return ErrVideoUnavailable
+	case strings.Contains(msg, "age restriction") || strings.Contains(msg, "confirm your age"):
+		return ErrAgeRestricted
+	case strings.Contains(msg, "region") || strings.Contains(msg, "geo"):
+		return ErrGeoBlocked
+	case strings.Contains(msg, "rate limit") || strings.Contains(msg, "429"):
+		return ErrRateLimited
+	default:
+		return ErrUpstreamUnavailable
+	}
+}
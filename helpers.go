@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// writeJSON encodes v as JSON and writes it to w with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+// mimeTypeFor returns the default mime type for a conversion type when the
+// upstream response doesn't carry a usable Content-Type header.
+func mimeTypeFor(conversionType string) string {
+	switch conversionType {
+	case "mp3":
+		return "audio/mpeg"
+	case "mp4", "merged":
+		return "video/mp4"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// JobState is the lifecycle state of an async conversion job.
+type JobState string
+
+const (
+	JobQueued      JobState = "queued"
+	JobDownloading JobState = "downloading"
+	JobUploading   JobState = "uploading"
+	JobDone        JobState = "done"
+	JobError       JobState = "error"
+)
+
+// JobProgress reports how far an in-flight job has gotten.
+type JobProgress struct {
+	Percentage float64 `json:"percentage"`
+	Bytes      int64   `json:"bytes"`
+	TotalBytes int64   `json:"total_bytes"`
+	ETA        string  `json:"eta,omitempty"`
+}
+
+// Job tracks one POST /convert?async=true request end to end.
+type Job struct {
+	ID          string      `json:"id"`
+	State       JobState    `json:"state"`
+	Progress    JobProgress `json:"progress"`
+	DownloadURL string      `json:"download_url,omitempty"`
+	Error       string      `json:"error,omitempty"`
+
+	startedAt time.Time
+}
+
+// jobRegistry is an in-memory store of in-flight and completed jobs. It is
+// intentionally process-local; a durable queue would back this with a real
+// store, but that's out of scope for this service.
+type jobRegistry struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+var jobs = &jobRegistry{jobs: map[string]*Job{}}
+
+func (jr *jobRegistry) create() *Job {
+	job := &Job{ID: newID(), State: JobQueued, startedAt: time.Now()}
+	jr.mu.Lock()
+	jr.jobs[job.ID] = job
+	jr.mu.Unlock()
+	return job
+}
+
+// get returns a snapshot of the job's current state. It copies the Job
+// under the read lock rather than returning the live pointer, since the
+// live *Job is concurrently mutated by update as the job progresses.
+func (jr *jobRegistry) get(id string) (Job, bool) {
+	jr.mu.RLock()
+	defer jr.mu.RUnlock()
+	job, ok := jr.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (jr *jobRegistry) update(id string, fn func(*Job)) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	if job, ok := jr.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+// newID returns a random hex identifier, used for both job and request IDs.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("fallback-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// progressETA estimates seconds remaining given bytes read so far, the
+// total expected, and elapsed time. Returns "" when it can't be estimated.
+func progressETA(read, total int64, elapsed time.Duration) string {
+	if total <= 0 || read <= 0 || elapsed <= 0 {
+		return ""
+	}
+	rate := float64(read) / elapsed.Seconds()
+	if rate <= 0 {
+		return ""
+	}
+	remaining := float64(total-read) / rate
+	return fmt.Sprintf("%.0fs", remaining)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// sinkForRequest picks a Sink based on the ?sink= query parameter.
+// Defaults to the local filesystem sink.
+func sinkForRequest(r *http.Request) (Sink, error) {
+	switch r.URL.Query().Get("sink") {
+	case "", "local":
+		dir := os.Getenv("LOCAL_SINK_DIR")
+		if dir == "" {
+			dir = os.TempDir()
+		}
+		return NewLocalSink(dir), nil
+	case "s3":
+		bucket := os.Getenv("S3_BUCKET")
+		if bucket == "" {
+			return nil, fmt.Errorf("S3_BUCKET is not configured")
+		}
+		client, err := newS3Client(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Sink(client, bucket), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q", r.URL.Query().Get("sink"))
+	}
+}
+
+// asyncConvertHandler implements POST /convert?async=true: it resolves the
+// download, kicks off a background download+upload into the requested sink,
+// and immediately returns a job_id the client can poll via /jobs/{id}.
+func asyncConvertHandler(w http.ResponseWriter, r *http.Request, videoURL, conversionType string) {
+	sink, err := sinkForRequest(r)
+	if err != nil {
+		writeError(w, r, ErrMissingParameter, fmt.Sprintf("failed to configure sink: %v", err))
+		return
+	}
+
+	job := jobs.create()
+	writeJSON(w, http.StatusAccepted, map[string]string{"job_id": job.ID})
+
+	go runConversionJob(job, sink, videoURL, conversionType)
+}
+
+func runConversionJob(job *Job, sink Sink, videoURL, conversionType string) {
+	jobs.update(job.ID, func(j *Job) { j.State = JobDownloading })
+
+	req, _ := http.NewRequest(http.MethodGet, "/convert", nil)
+	resolvedURL, filename, _, err := resolveDownload(req, videoURL, conversionType)
+	if err != nil {
+		jobs.update(job.ID, func(j *Job) {
+			j.State = JobError
+			j.Error = err.Error()
+		})
+		return
+	}
+
+	client := &http.Client{Timeout: 0}
+	resp, err := client.Get(resolvedURL)
+	if err != nil {
+		jobs.update(job.ID, func(j *Job) {
+			j.State = JobError
+			j.Error = err.Error()
+		})
+		return
+	}
+	defer resp.Body.Close()
+
+	size := resp.ContentLength
+	started := time.Now()
+	jobs.update(job.ID, func(j *Job) { j.State = JobUploading })
+
+	onProgress := func(read, total int64) {
+		jobs.update(job.ID, func(j *Job) {
+			j.Progress.Bytes = read
+			j.Progress.TotalBytes = total
+			if total > 0 {
+				j.Progress.Percentage = 100 * float64(read) / float64(total)
+			}
+			j.Progress.ETA = progressETA(read, total, time.Since(started))
+		})
+	}
+
+	location, err := sink.Upload(context.Background(), filename, resp.Body, size, onProgress)
+	if err != nil {
+		jobs.update(job.ID, func(j *Job) {
+			j.State = JobError
+			j.Error = err.Error()
+		})
+		return
+	}
+
+	downloadURL := location
+	if signer, ok := sink.(SignedURLSink); ok {
+		if signed, err := signer.SignedURL(context.Background(), filename); err == nil {
+			downloadURL = signed
+		} else {
+			log.Printf("Failed to presign download URL for job %s: %v", job.ID, err)
+		}
+	}
+
+	jobs.update(job.ID, func(j *Job) {
+		j.State = JobDone
+		j.DownloadURL = downloadURL
+		j.Progress.Percentage = 100
+	})
+}
+
+// jobsHandler implements GET /jobs/{id} and GET /jobs/{id}/download.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	id, sub, hasSub := strings.Cut(rest, "/")
+	if id == "" {
+		writeError(w, r, ErrMissingParameter, "missing job id")
+		return
+	}
+
+	job, ok := jobs.get(id)
+	if !ok {
+		writeError(w, r, ErrNotFound, "job not found")
+		return
+	}
+
+	if !hasSub {
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+
+	switch sub {
+	case "download":
+		if job.State != JobDone {
+			writeError(w, r, ErrConversionFailed, fmt.Sprintf("job is not done yet (state: %s)", job.State))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"download_url": job.DownloadURL})
+	default:
+		writeError(w, r, ErrMissingParameter, "unknown job sub-resource")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -23,6 +24,15 @@ type ConversionResponse struct {
 	Size        string `json:"size"`
 	MimeType    string `json:"mime_type"`
 	DownloadURL string `json:"download_url,omitempty"` // Optional, if we decide to provide a link instead of streaming
+
+	// Populated when the native backend served the request, describing the
+	// format that was actually selected.
+	Itag         int    `json:"itag,omitempty"`
+	Quality      string `json:"quality,omitempty"`
+	QualityLabel string `json:"quality_label,omitempty"`
+	Bitrate      int    `json:"bitrate,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
 }
 
 // VeviozAPIResponse represents the structure of the response from vevioz.com API
@@ -36,7 +46,15 @@ type VeviozAPIResponse struct {
 }
 
 func main() {
-	http.HandleFunc("/convert", convertHandler)
+	// /convert and /stream can return either JSON or a raw media stream
+	// depending on query flags, so they don't enforce an Accept header.
+	http.HandleFunc("/convert", chain(convertHandler, withRequestID))
+	http.HandleFunc("/stream", chain(streamHandler, withRequestID))
+
+	http.HandleFunc("/formats", chain(formatsHandler, withRequestID, requireAccept("application/json")))
+	http.HandleFunc("/batch", chain(batchHandler, withRequestID, requireAccept(batchMediaType), requireContentType(batchMediaType)))
+	http.HandleFunc("/verify", chain(verifyHandler, withRequestID, requireAccept("application/json"), requireContentType("application/json")))
+	http.HandleFunc("/jobs/", chain(jobsHandler, withRequestID, requireAccept("application/json")))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -54,22 +72,45 @@ func convertHandler(w http.ResponseWriter, r *http.Request) {
 	conversionType := r.URL.Query().Get("type")
 
 	if videoURL == "" || conversionType == "" {
-		http.Error(w, "Missing 'url' or 'type' parameter", http.StatusBadRequest)
+		writeError(w, r, ErrMissingParameter, "missing 'url' or 'type' parameter")
 		log.Printf("Bad request: Missing 'url' or 'type'")
 		return
 	}
 
 	if !isValidConversionType(conversionType) {
-		http.Error(w, "Invalid 'type' parameter. Must be 'mp3', 'mp4', or 'merged'.", http.StatusBadRequest)
+		writeError(w, r, ErrInvalidConversionType, "invalid 'type' parameter. Must be 'mp3', 'mp4', or 'merged'.")
 		log.Printf("Bad request: Invalid 'type' %s", conversionType)
 		return
 	}
 
+	if r.URL.Query().Get("stream") == "true" {
+		streamHandler(w, r)
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" {
+		asyncConvertHandler(w, r, videoURL, conversionType)
+		return
+	}
+
+	backend := r.URL.Query().Get("backend")
+	if backend == "" {
+		backend = "native"
+	}
+
+	if backend == "native" {
+		if err := convertNative(w, r, videoURL, conversionType); err != nil {
+			log.Printf("Native backend failed, falling back to vevioz: %v", err)
+		} else {
+			return
+		}
+	}
+
 	// Construct vevioz.com API URL
 	apiEndpoint := fmt.Sprintf("%s/%s", veviozAPIURL, conversionType)
 	veviozReqURL, err := url.Parse(apiEndpoint)
 	if err != nil {
-		http.Error(w, "Internal server error: Failed to parse API URL", http.StatusInternalServerError)
+		writeError(w, r, ErrConversionFailed, "internal server error: failed to parse API URL")
 		log.Printf("Error parsing vevioz API URL: %v", err)
 		return
 	}
@@ -83,7 +124,7 @@ func convertHandler(w http.ResponseWriter, r *http.Request) {
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Get(veviozReqURL.String())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to conversion service: %v", err), http.StatusBadGateway)
+		writeError(w, r, ErrUpstreamUnavailable, fmt.Sprintf("failed to connect to conversion service: %v", err))
 		log.Printf("Error connecting to vevioz.com: %v", err)
 		return
 	}
@@ -92,13 +133,13 @@ func convertHandler(w http.ResponseWriter, r *http.Request) {
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		log.Printf("Vevioz API returned non-200 status: %d, Body: %s", resp.StatusCode, string(bodyBytes))
-		http.Error(w, fmt.Sprintf("Conversion service returned an error: Status %d", resp.StatusCode), http.StatusBadGateway)
+		writeError(w, r, ErrUpstreamStatusError, fmt.Sprintf("conversion service returned an error: status %d", resp.StatusCode))
 		return
 	}
 
 	var veviozResponse VeviozAPIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&veviozResponse); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to parse conversion service response: %v", err), http.StatusInternalServerError)
+		writeError(w, r, ErrUpstreamDecodeError, fmt.Sprintf("failed to parse conversion service response: %v", err))
 		log.Printf("Error decoding vevioz.com response: %v", err)
 		return
 	}
@@ -108,7 +149,7 @@ func convertHandler(w http.ResponseWriter, r *http.Request) {
 		if errMsg == "" {
 			errMsg = "Unknown error from conversion service"
 		}
-		http.Error(w, fmt.Sprintf("Conversion failed: %s", errMsg), http.StatusBadGateway)
+		writeError(w, r, classifyUpstreamError(errors.New(errMsg)), fmt.Sprintf("conversion failed: %s", errMsg))
 		log.Printf("Vevioz API status not 'ok' or URL empty: %s, Error: %s", veviozResponse.Status, veviozResponse.Error)
 		return
 	}
@@ -118,7 +159,7 @@ func convertHandler(w http.ResponseWriter, r *http.Request) {
 	// Download the converted file
 	downloadResp, err := client.Get(veviozResponse.URL)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to download converted file: %v", err), http.StatusInternalServerError)
+		writeError(w, r, ErrConversionFailed, fmt.Sprintf("failed to download converted file: %v", err))
 		log.Printf("Error downloading converted file: %v", err)
 		return
 	}
@@ -127,7 +168,7 @@ func convertHandler(w http.ResponseWriter, r *http.Request) {
 	if downloadResp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(downloadResp.Body)
 		log.Printf("Download URL returned non-200 status: %d, Body: %s", downloadResp.StatusCode, string(bodyBytes))
-		http.Error(w, fmt.Sprintf("Failed to download converted file: Status %d", downloadResp.StatusCode), http.StatusInternalServerError)
+		writeError(w, r, ErrUpstreamStatusError, fmt.Sprintf("failed to download converted file: status %d", downloadResp.StatusCode))
 		return
 	}
 
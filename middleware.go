@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+const requestIDContextKey contextKey = "request_id"
+
+// withRequestID assigns every request an ID (reusing one supplied via
+// X-Request-Id if the caller already has one), logs it, and echoes it back
+// in the response header so failures can be correlated against server logs.
+func withRequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" {
+			id = newID()
+		}
+		w.Header().Set("X-Request-Id", id)
+		log.Printf("[%s] %s %s", id, r.Method, r.URL.Path)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// requireAccept enforces that the request's Accept header is empty, "*/*",
+// or lists one of the given media types among its (possibly compound,
+// q-weighted) entries, so JSON-returning endpoints don't have to guess what
+// the caller wants back.
+func requireAccept(accepted ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			accept := r.Header.Get("Accept")
+			if accept == "" || acceptListMatches(accept, accepted) {
+				next(w, r)
+				return
+			}
+			writeError(w, r, ErrUnsupportedContentType, fmt.Sprintf("Accept header must be one of %v", accepted))
+		}
+	}
+}
+
+// acceptListMatches reports whether accept - a comma-separated Accept header
+// that may carry multiple media types with q-value/other parameters, e.g.
+// "application/json, text/plain, */*" - contains "*/*" or any of want.
+func acceptListMatches(accept string, want []string) bool {
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		if mediaType == "*/*" {
+			return true
+		}
+		for _, w := range want {
+			if mediaType == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requireContentType enforces Content-Type on request bodies for POST/PUT
+// requests, returning unsupported_content_type instead of a generic 400.
+// The comparison ignores parameters such as "; charset=utf-8".
+func requireContentType(want string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost || r.Method == http.MethodPut {
+				mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+				if err != nil || mediaType != want {
+					writeError(w, r, ErrUnsupportedContentType, fmt.Sprintf("Content-Type header must be %q", want))
+					return
+				}
+			}
+			next(w, r)
+		}
+	}
+}
+
+// chain applies middlewares to h in the given order, so chain(h, a, b) runs
+// as a(b(h)).
+func chain(h http.HandlerFunc, mws ...func(http.HandlerFunc) http.HandlerFunc) http.HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kkdai/youtube/v2"
+)
+
+// FormatInfo is the JSON shape returned by /formats for a single itag.
+type FormatInfo struct {
+	Itag             int    `json:"itag"`
+	MimeType         string `json:"mime_type"`
+	Quality          string `json:"quality"`
+	QualityLabel     string `json:"quality_label"`
+	Bitrate          int    `json:"bitrate"`
+	FPS              int    `json:"fps"`
+	Width            int    `json:"width"`
+	Height           int    `json:"height"`
+	ContentLength    int64  `json:"content_length"`
+	ApproxDurationMs int64  `json:"approx_duration_ms"`
+	AudioChannels    int    `json:"audio_channels"`
+	AudioSampleRate  string `json:"audio_sample_rate"`
+	AudioQuality     string `json:"audio_quality"`
+}
+
+var youtubeClient = youtube.Client{}
+
+// formatsHandler implements GET /formats?url=... and lists every itag
+// available for the given video so clients can pick one explicitly.
+func formatsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	videoURL := r.URL.Query().Get("url")
+	if videoURL == "" {
+		writeError(w, r, ErrMissingParameter, "missing 'url' parameter")
+		return
+	}
+
+	video, err := youtubeClient.GetVideo(videoURL)
+	if err != nil {
+		writeError(w, r, classifyUpstreamError(err), fmt.Sprintf("failed to resolve video: %v", err))
+		log.Printf("Error resolving video %s: %v", videoURL, err)
+		return
+	}
+
+	formats := make([]FormatInfo, 0, len(video.Formats))
+	for _, f := range video.Formats {
+		formats = append(formats, toFormatInfo(f))
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i].Itag < formats[j].Itag })
+
+	writeJSON(w, http.StatusOK, formats)
+}
+
+func toFormatInfo(f youtube.Format) FormatInfo {
+	// ApproxDurationMs comes back from YouTube as a numeric string.
+	approxDurationMs, _ := strconv.ParseInt(f.ApproxDurationMs, 10, 64)
+
+	return FormatInfo{
+		Itag:             f.ItagNo,
+		MimeType:         f.MimeType,
+		Quality:          f.Quality,
+		QualityLabel:     f.QualityLabel,
+		Bitrate:          f.Bitrate,
+		FPS:              f.FPS,
+		Width:            f.Width,
+		Height:           f.Height,
+		ContentLength:    f.ContentLength,
+		ApproxDurationMs: approxDurationMs,
+		AudioChannels:    f.AudioChannels,
+		AudioSampleRate:  f.AudioSampleRate,
+		AudioQuality:     f.AudioQuality,
+	}
+}
+
+// selectFormat resolves the itag/min_height/max_bitrate/audio_only query
+// parameters against a video's available formats, in that priority order.
+// An explicit itag always wins; otherwise conversionType constrains the
+// candidates to audio-only formats for "mp3" or video formats for
+// "mp4"/"merged", the same contract the vevioz fallback honors.
+func selectFormat(video *youtube.Video, r *http.Request, conversionType string) (*youtube.Format, error) {
+	q := r.URL.Query()
+
+	if itagStr := q.Get("itag"); itagStr != "" {
+		itag, err := strconv.Atoi(itagStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'itag' parameter: %w", err)
+		}
+		for i := range video.Formats {
+			if video.Formats[i].ItagNo == itag {
+				return &video.Formats[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no format with itag %d", itag)
+	}
+
+	candidates := video.Formats
+	switch {
+	case q.Get("audio_only") == "true" || conversionType == "mp3":
+		candidates = candidates.Type("audio")
+	case conversionType == "mp4" || conversionType == "merged":
+		candidates = candidates.Type("video")
+	}
+	if minHeightStr := q.Get("min_height"); minHeightStr != "" {
+		minHeight, err := strconv.Atoi(minHeightStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'min_height' parameter: %w", err)
+		}
+		filtered := make(youtube.FormatList, 0, len(candidates))
+		for _, f := range candidates {
+			if f.Height >= minHeight {
+				filtered = append(filtered, f)
+			}
+		}
+		candidates = filtered
+	}
+	if maxBitrateStr := q.Get("max_bitrate"); maxBitrateStr != "" {
+		maxBitrate, err := strconv.Atoi(maxBitrateStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'max_bitrate' parameter: %w", err)
+		}
+		filtered := make(youtube.FormatList, 0, len(candidates))
+		for _, f := range candidates {
+			if f.Bitrate <= maxBitrate {
+				filtered = append(filtered, f)
+			}
+		}
+		candidates = filtered
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no format matches the given selectors")
+	}
+	candidates.Sort()
+	best := candidates[0]
+	return &best, nil
+}
+
+// resolveNativeFormat resolves videoURL with the kkdai/youtube client and
+// applies the request's format selectors, without fetching the stream body.
+func resolveNativeFormat(r *http.Request, videoURL, conversionType string) (*youtube.Video, *youtube.Format, error) {
+	video, err := youtubeClient.GetVideo(videoURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("native backend: resolve video: %w", err)
+	}
+
+	format, err := selectFormat(video, r, conversionType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("native backend: select format: %w", err)
+	}
+	return video, format, nil
+}
+
+// convertNative resolves videoURL with the kkdai/youtube client and either
+// streams the chosen format's body directly (the default) or, with
+// metadata=true, returns a ConversionResponse describing the selected
+// format without downloading it.
+func convertNative(w http.ResponseWriter, r *http.Request, videoURL, conversionType string) error {
+	video, format, err := resolveNativeFormat(r, videoURL, conversionType)
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("metadata") == "true" {
+		return writeNativeMetadata(w, video, format, conversionType)
+	}
+
+	stream, size, err := youtubeClient.GetStream(video, format)
+	if err != nil {
+		return fmt.Errorf("native backend: open stream: %w", err)
+	}
+	defer stream.Close()
+
+	filename := sanitizeFilename(video.Title) + extensionFor(conversionType, format.MimeType)
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Type", format.MimeType)
+	if size > 0 {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// Past this point the response is committed: convertHandler must not
+	// fall back to vevioz on a copy error, since that would mean writing a
+	// second set of headers/body onto an already-started response. Log and
+	// swallow instead.
+	if _, err := io.Copy(w, stream); err != nil {
+		log.Printf("native backend: error streaming body for %s: %v", videoURL, err)
+	}
+	return nil
+}
+
+// writeNativeMetadata resolves the format's playable URL and returns it
+// alongside the selected format's metadata, without downloading the body.
+func writeNativeMetadata(w http.ResponseWriter, video *youtube.Video, format *youtube.Format, conversionType string) error {
+	streamURL, err := youtubeClient.GetStreamURL(video, format)
+	if err != nil {
+		return fmt.Errorf("native backend: resolve stream URL: %w", err)
+	}
+
+	writeJSON(w, http.StatusOK, ConversionResponse{
+		Filename:     sanitizeFilename(video.Title) + extensionFor(conversionType, format.MimeType),
+		MimeType:     format.MimeType,
+		DownloadURL:  streamURL,
+		Itag:         format.ItagNo,
+		Quality:      format.Quality,
+		QualityLabel: format.QualityLabel,
+		Bitrate:      format.Bitrate,
+		Width:        format.Width,
+		Height:       format.Height,
+	})
+	return nil
+}
+
+func extensionFor(conversionType, mimeType string) string {
+	switch conversionType {
+	case "mp3":
+		return ".mp3"
+	case "mp4":
+		return ".mp4"
+	default:
+		if strings.Contains(mimeType, "webm") {
+			return ".webm"
+		}
+		return ".mp4"
+	}
+}
+
+// sanitizeFilename strips path separators, ".." traversal segments, and
+// control characters from a video title so it's safe to use as a filename
+// or storage key. Anything that sanitizes away to nothing falls back to a
+// generic name.
+func sanitizeFilename(title string) string {
+	var b strings.Builder
+	for _, r := range title {
+		switch {
+		case r == '/' || r == '\\' || r == 0:
+			continue
+		case r < 0x20 || r == 0x7f:
+			continue
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name := strings.TrimSpace(b.String())
+	name = strings.ReplaceAll(name, "..", "")
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "converted_video"
+	}
+	return name
+}
@@ -0,0 +1,24 @@
+package main
+
+import "io"
+
+// progressReader wraps an io.Reader, tracking bytes read against an expected
+// total and invoking onProgress after every read so callers can publish
+// percentage/bytes/ETA updates as a download or upload proceeds.
+type progressReader struct {
+	r          io.Reader
+	total      int64
+	read       int64
+	onProgress func(read, total int64)
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.read += int64(n)
+		if p.onProgress != nil {
+			p.onProgress(p.read, p.total)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// newS3Client builds an S3 client from the standard AWS credential chain
+// (env vars, shared config, instance role, etc).
+func newS3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+// s3PartSize sits within S3's required 5-16 MiB multipart chunk range.
+const s3PartSize = 8 * 1024 * 1024
+
+// Sink persists a converted file's bytes to durable storage and returns a
+// location the file can later be retrieved from.
+type Sink interface {
+	Upload(ctx context.Context, name string, body io.Reader, size int64, onProgress func(written, total int64)) (string, error)
+}
+
+// LocalSink writes converted files to a directory on the local filesystem.
+type LocalSink struct {
+	Dir string
+}
+
+// NewLocalSink returns a Sink that stores files under dir.
+func NewLocalSink(dir string) *LocalSink {
+	return &LocalSink{Dir: dir}
+}
+
+// Upload implements Sink.
+func (s *LocalSink) Upload(ctx context.Context, name string, body io.Reader, size int64, onProgress func(written, total int64)) (string, error) {
+	path := filepath.Join(s.Dir, name)
+	if rel, err := filepath.Rel(s.Dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("local sink: %q escapes storage directory", name)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("local sink: create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	pr := &progressReader{r: body, total: size, onProgress: onProgress}
+	if _, err := io.Copy(f, pr); err != nil {
+		return "", fmt.Errorf("local sink: write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// S3Sink uploads converted files to S3 using a multipart upload, so large
+// files don't need to be buffered in memory before the upload starts.
+type S3Sink struct {
+	Client *s3.Client
+	Bucket string
+}
+
+// NewS3Sink returns a Sink that stores files in the given bucket.
+func NewS3Sink(client *s3.Client, bucket string) *S3Sink {
+	return &S3Sink{Client: client, Bucket: bucket}
+}
+
+// Upload implements Sink by driving CreateMultipartUpload -> UploadPart ->
+// CompleteMultipartUpload, aborting the upload if any part fails.
+func (s *S3Sink) Upload(ctx context.Context, name string, body io.Reader, size int64, onProgress func(written, total int64)) (string, error) {
+	created, err := s.Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 sink: create multipart upload: %w", err)
+	}
+
+	pr := &progressReader{r: body, total: size, onProgress: onProgress}
+
+	var parts []types.CompletedPart
+	buf := make([]byte, s3PartSize)
+	partNumber := int32(1)
+	for {
+		n, readErr := io.ReadFull(pr, buf)
+		if n > 0 {
+			out, uploadErr := s.Client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String(s.Bucket),
+				Key:        aws.String(name),
+				UploadId:   created.UploadId,
+				PartNumber: aws.Int32(partNumber),
+				Body:       bytes.NewReader(buf[:n]),
+			})
+			if uploadErr != nil {
+				s.abort(ctx, name, created.UploadId)
+				return "", fmt.Errorf("s3 sink: upload part %d: %w", partNumber, uploadErr)
+			}
+			parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(partNumber)})
+			partNumber++
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			s.abort(ctx, name, created.UploadId)
+			return "", fmt.Errorf("s3 sink: read body: %w", readErr)
+		}
+	}
+
+	_, err = s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.Bucket),
+		Key:             aws.String(name),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 sink: complete multipart upload: %w", err)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, name), nil
+}
+
+// signedURLTTL controls how long a presigned S3 download link stays valid.
+const signedURLTTL = 15 * time.Minute
+
+// SignedURLSink is implemented by sinks that can hand back a time-limited
+// download link instead of requiring the caller to fetch through us.
+type SignedURLSink interface {
+	SignedURL(ctx context.Context, name string) (string, error)
+}
+
+// SignedURL implements SignedURLSink.
+func (s *S3Sink) SignedURL(ctx context.Context, name string) (string, error) {
+	presignClient := s3.NewPresignClient(s.Client)
+	req, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(name),
+	}, s3.WithPresignExpires(signedURLTTL))
+	if err != nil {
+		return "", fmt.Errorf("s3 sink: presign: %w", err)
+	}
+	return req.URL, nil
+}
+
+func (s *S3Sink) abort(ctx context.Context, key string, uploadID *string) {
+	_, err := s.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.Bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		log.Printf("s3 sink: failed to abort multipart upload for %s: %v", key, err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// modTimeZero is passed to http.ServeContent in place of a real modification
+// time: upstream YouTube URLs don't carry one and we don't want ServeContent
+// second-guessing freshness with If-Modified-Since.
+var modTimeZero time.Time
+
+// resolveDownload figures out the upstream URL, filename and mime type for a
+// video/type pair without downloading the body, trying the native backend
+// first and falling back to vevioz.com.
+func resolveDownload(r *http.Request, videoURL, conversionType string) (resolvedURL, filename, mimeType string, err error) {
+	if video, format, ferr := resolveNativeFormat(r, videoURL, conversionType); ferr == nil {
+		// format.URL is empty for formats using a signatureCipher; it must be
+		// deciphered via GetStreamURL rather than read directly.
+		streamURL, serr := youtubeClient.GetStreamURL(video, format)
+		if serr == nil {
+			filename = sanitizeFilename(video.Title) + extensionFor(conversionType, format.MimeType)
+			return streamURL, filename, format.MimeType, nil
+		}
+	}
+
+	apiEndpoint := fmt.Sprintf("%s/%s", veviozAPIURL, conversionType)
+	veviozReqURL, err := url.Parse(apiEndpoint)
+	if err != nil {
+		return "", "", "", err
+	}
+	q := veviozReqURL.Query()
+	q.Set("url", videoURL)
+	veviozReqURL.RawQuery = q.Encode()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(veviozReqURL.String())
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+
+	var veviozResponse VeviozAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&veviozResponse); err != nil {
+		return "", "", "", err
+	}
+	if veviozResponse.Status != "ok" || veviozResponse.URL == "" {
+		return "", "", "", fmt.Errorf("vevioz: %s", veviozResponse.Error)
+	}
+
+	filename = veviozResponse.Title
+	if filename == "" {
+		filename = fmt.Sprintf("converted_video_%d", time.Now().Unix())
+	}
+	filename += extensionFor(conversionType, "")
+	return veviozResponse.URL, filename, mimeTypeFor(conversionType), nil
+}
+
+// remoteReadSeeker adapts an upstream HTTP resource into an io.ReadSeeker by
+// issuing ranged GET requests on demand. It never buffers the whole file.
+type remoteReadSeeker struct {
+	client *http.Client
+	url    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func newRemoteReadSeeker(client *http.Client, url string) (*remoteReadSeeker, error) {
+	size, err := getRemoteFileSize(url)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteReadSeeker{client: client, url: url, size: size}, nil
+}
+
+func (rs *remoteReadSeeker) Read(p []byte) (int, error) {
+	if rs.body == nil {
+		if err := rs.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rs.body.Read(p)
+	rs.offset += int64(n)
+	return n, err
+}
+
+func (rs *remoteReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = rs.offset + offset
+	case io.SeekEnd:
+		target = rs.size + offset
+	default:
+		return 0, fmt.Errorf("remoteReadSeeker: invalid whence %d", whence)
+	}
+	if target < 0 {
+		return 0, errors.New("remoteReadSeeker: negative position")
+	}
+
+	if rs.body != nil {
+		rs.body.Close()
+		rs.body = nil
+	}
+	rs.offset = target
+	return rs.offset, nil
+}
+
+func (rs *remoteReadSeeker) Close() error {
+	if rs.body != nil {
+		return rs.body.Close()
+	}
+	return nil
+}
+
+func (rs *remoteReadSeeker) open() error {
+	req, err := http.NewRequest(http.MethodGet, rs.url, nil)
+	if err != nil {
+		return err
+	}
+	if rs.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", rs.offset))
+	}
+
+	resp, err := rs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return fmt.Errorf("remoteReadSeeker: upstream returned status %d", resp.StatusCode)
+	}
+	rs.body = resp.Body
+	return nil
+}
+
+// streamHandler implements GET/HEAD /stream?url=...&type=... and proxies the
+// resolved conversion to the client via http.ServeContent, which transparently
+// honors Range requests so browsers can scrub and resume downloads.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Received request: %s %s", r.Method, r.URL.Path)
+
+	videoURL := r.URL.Query().Get("url")
+	conversionType := r.URL.Query().Get("type")
+	if videoURL == "" || conversionType == "" {
+		writeError(w, r, ErrMissingParameter, "missing 'url' or 'type' parameter")
+		return
+	}
+	if !isValidConversionType(conversionType) {
+		writeError(w, r, ErrInvalidConversionType, "invalid 'type' parameter. Must be 'mp3', 'mp4', or 'merged'.")
+		return
+	}
+
+	resolvedURL, filename, mimeType, err := resolveDownload(r, videoURL, conversionType)
+	if err != nil {
+		writeError(w, r, classifyUpstreamError(err), fmt.Sprintf("failed to resolve download: %v", err))
+		log.Printf("Error resolving stream for %s: %v", videoURL, err)
+		return
+	}
+
+	client := &http.Client{Timeout: 0}
+	rs, err := newRemoteReadSeeker(client, resolvedURL)
+	if err != nil {
+		// Upstream didn't give us a Content-Length (common for on-the-fly mp3
+		// transcodes), so we can't seek. Fall back to a plain chunked proxy.
+		streamWithoutSeek(w, r, client, resolvedURL, filename, mimeType)
+		return
+	}
+	defer rs.Close()
+
+	// http.ServeContent derives Content-Type from filename's extension, which
+	// extensionFor already set to match mimeType.
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	http.ServeContent(w, r, filename, modTimeZero, rs)
+}
+
+// streamWithoutSeek proxies the upstream body as-is when its size is unknown
+// ahead of time (e.g. an on-the-fly mp3 transcode), advertising that range
+// requests aren't supported. Estimating Content-Length for this case isn't
+// implemented, since there's no reliable way to predict a transcode's output
+// size upfront; clients get chunked transfer instead. A HEAD request never
+// fetches the upstream body, only its headers.
+func streamWithoutSeek(w http.ResponseWriter, r *http.Request, client *http.Client, resolvedURL, filename, mimeType string) {
+	req, err := http.NewRequest(r.Method, resolvedURL, nil)
+	if err != nil {
+		writeError(w, r, ErrUpstreamUnavailable, fmt.Sprintf("failed to build upstream request: %v", err))
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		writeError(w, r, ErrUpstreamUnavailable, fmt.Sprintf("failed to fetch upstream file: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Accept-Ranges", "none")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("Error streaming upstream body: %v", err)
+	}
+}